@@ -8,35 +8,47 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sync"
 	"unicode/utf8"
 )
 
-// commandSize is the fixed size of all commands in the common bitcoin message
+// CommandSize is the fixed size of all commands in the common bitcoin message
 // header.  Shorter commands must be zero padded.
-const commandSize = 12
+const CommandSize = 12
 
-// maxMessagePayload is the maximum bytes a message can be regardless of other
+// MaxMessagePayload is the maximum bytes a message can be regardless of other
 // individual limits imposed by messages themselves.
-const maxMessagePayload = (1024 * 1024 * 32) // 32MB
+const MaxMessagePayload = (1024 * 1024 * 32) // 32MB
+
+// MessageHeaderSize is the number of bytes in a bitcoin message header.
+// Bitcoin network (magic) 4 bytes + command 12 bytes + payload length 4
+// bytes + checksum 4 bytes.
+const MessageHeaderSize = 4 + CommandSize + 4 + 4
 
 // Commands used in bitcoin message headers which describe the type of message.
 const (
-	cmdVersion    = "version"
-	cmdVerAck     = "verack"
-	cmdGetAddr    = "getaddr"
-	cmdAddr       = "addr"
-	cmdGetBlocks  = "getblocks"
-	cmdInv        = "inv"
-	cmdGetData    = "getdata"
-	cmdNotFound   = "notfound"
-	cmdBlock      = "block"
-	cmdTx         = "tx"
-	cmdGetHeaders = "getheaders"
-	cmdHeaders    = "headers"
-	cmdPing       = "ping"
-	cmdPong       = "pong"
-	cmdAlert      = "alert"
-	cmdMemPool    = "mempool"
+	cmdVersion     = "version"
+	cmdVerAck      = "verack"
+	cmdGetAddr     = "getaddr"
+	cmdAddr        = "addr"
+	cmdGetBlocks   = "getblocks"
+	cmdInv         = "inv"
+	cmdGetData     = "getdata"
+	cmdNotFound    = "notfound"
+	cmdBlock       = "block"
+	cmdTx          = "tx"
+	cmdGetHeaders  = "getheaders"
+	cmdHeaders     = "headers"
+	cmdPing        = "ping"
+	cmdPong        = "pong"
+	cmdAlert       = "alert"
+	cmdMemPool     = "mempool"
+	cmdFilterAdd   = "filteradd"
+	cmdFilterClear = "filterclear"
+	cmdFilterLoad  = "filterload"
+	cmdMerkleBlock = "merkleblock"
+	cmdSendHeaders = "sendheaders"
+	cmdFeeFilter   = "feefilter"
 )
 
 // Message is an interface that describes a bitcoin message.  A type that
@@ -50,63 +62,92 @@ type Message interface {
 	MaxPayloadLength(uint32) uint32
 }
 
-// makeEmptyMessage creates a message of the appropriate concrete type based
-// on the command.
-func makeEmptyMessage(command string) (Message, error) {
-	var msg Message
-	switch command {
-	case cmdVersion:
-		msg = &MsgVersion{}
-
-	case cmdVerAck:
-		msg = &MsgVerAck{}
-
-	case cmdGetAddr:
-		msg = &MsgGetAddr{}
-
-	case cmdAddr:
-		msg = &MsgAddr{}
-
-	case cmdGetBlocks:
-		msg = &MsgGetBlocks{}
-
-	case cmdBlock:
-		msg = &MsgBlock{}
-
-	case cmdInv:
-		msg = &MsgInv{}
-
-	case cmdGetData:
-		msg = &MsgGetData{}
-
-	case cmdNotFound:
-		msg = &MsgNotFound{}
-
-	case cmdTx:
-		msg = &MsgTx{}
-
-	case cmdPing:
-		msg = &MsgPing{}
-
-	case cmdPong:
-		msg = &MsgPong{}
-
-	case cmdGetHeaders:
-		msg = &MsgGetHeaders{}
-
-	case cmdHeaders:
-		msg = &MsgHeaders{}
+// msgFactory is a function that returns a new, empty Message of a specific
+// concrete type.  Factories are keyed by the wire command string they
+// handle in the package-level message registry.
+type msgFactory func() Message
+
+// msgRegistryMu protects msgRegistry so it can be read concurrently by
+// makeEmptyMessage once the package has finished registering the builtin
+// commands at init time.
+var msgRegistryMu sync.RWMutex
+
+// msgRegistry maps a wire command string to the factory function used to
+// create an empty Message of the appropriate concrete type for it.  It is
+// seeded with the builtin commands in init and may be extended by callers
+// via RegisterMessage.
+var msgRegistry = make(map[string]msgFactory)
+
+// RegisterMessage registers a factory function that creates a new, empty
+// Message for the given command so makeEmptyMessage (and therefore
+// ReadMessage) knows how to decode messages of that type.  This allows
+// downstream forks and altcoins that reuse the bitcoin wire framing to add
+// their own commands without forking this package.  It returns an error if
+// command is already registered.
+func RegisterMessage(command string, factory func() Message) error {
+	msgRegistryMu.Lock()
+	defer msgRegistryMu.Unlock()
+
+	if _, ok := msgRegistry[command]; ok {
+		str := fmt.Sprintf("message command [%s] is already registered",
+			command)
+		return messageError("RegisterMessage", str)
+	}
+	msgRegistry[command] = factory
+	return nil
+}
 
-	case cmdAlert:
-		msg = &MsgAlert{}
+// UnregisterMessage removes the factory function previously registered for
+// command, if any.  It is a no-op if command was never registered.
+func UnregisterMessage(command string) {
+	msgRegistryMu.Lock()
+	defer msgRegistryMu.Unlock()
+	delete(msgRegistry, command)
+}
 
-	case cmdMemPool:
-		msg = &MsgMemPool{}
+// init seeds the message registry with the builtin bitcoin wire commands.
+func init() {
+	builtinMessages := map[string]msgFactory{
+		cmdVersion:     func() Message { return &MsgVersion{} },
+		cmdVerAck:      func() Message { return &MsgVerAck{} },
+		cmdGetAddr:     func() Message { return &MsgGetAddr{} },
+		cmdAddr:        func() Message { return &MsgAddr{} },
+		cmdGetBlocks:   func() Message { return &MsgGetBlocks{} },
+		cmdBlock:       func() Message { return &MsgBlock{} },
+		cmdInv:         func() Message { return &MsgInv{} },
+		cmdGetData:     func() Message { return &MsgGetData{} },
+		cmdNotFound:    func() Message { return &MsgNotFound{} },
+		cmdTx:          func() Message { return &MsgTx{} },
+		cmdPing:        func() Message { return &MsgPing{} },
+		cmdPong:        func() Message { return &MsgPong{} },
+		cmdGetHeaders:  func() Message { return &MsgGetHeaders{} },
+		cmdHeaders:     func() Message { return &MsgHeaders{} },
+		cmdAlert:       func() Message { return &MsgAlert{} },
+		cmdMemPool:     func() Message { return &MsgMemPool{} },
+		cmdFilterAdd:   func() Message { return &MsgFilterAdd{} },
+		cmdFilterClear: func() Message { return &MsgFilterClear{} },
+		cmdFilterLoad:  func() Message { return &MsgFilterLoad{} },
+		cmdMerkleBlock: func() Message { return &MsgMerkleBlock{} },
+		cmdSendHeaders: func() Message { return &MsgSendHeaders{} },
+		cmdFeeFilter:   func() Message { return &MsgFeeFilter{} },
+	}
+	for command, factory := range builtinMessages {
+		if err := RegisterMessage(command, factory); err != nil {
+			panic(err)
+		}
+	}
+}
 
-	default:
+// makeEmptyMessage creates a message of the appropriate concrete type based
+// on the command by consulting the message registry.
+func makeEmptyMessage(command string) (Message, error) {
+	msgRegistryMu.RLock()
+	factory, ok := msgRegistry[command]
+	msgRegistryMu.RUnlock()
+	if !ok {
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
-	return msg, nil
+	return factory(), nil
 }
 
 // messageHeader defines the header structure for all bitcoin protocol messages.
@@ -117,53 +158,73 @@ type messageHeader struct {
 	checksum [4]byte    // 4 bytes
 }
 
-// readMessageHeader reads a bitcoin message header from r.
-func readMessageHeader(r io.Reader) (*messageHeader, error) {
-	var command [commandSize]byte
+// readMessageHeader reads a bitcoin message header from r and returns the
+// number of bytes read in addition to the header.
+func readMessageHeader(r io.Reader) (int, *messageHeader, error) {
+	// Since readElements doesn't return the number of bytes read, attempt
+	// to read the entire header into a buffer first so the number of
+	// bytes consumed is known even when an error occurs while parsing it.
+	var headerBytes [MessageHeaderSize]byte
+	n, err := io.ReadFull(r, headerBytes[:])
+	if err != nil {
+		return n, nil, err
+	}
+	hr := bytes.NewReader(headerBytes[:])
 
+	var command [CommandSize]byte
 	hdr := messageHeader{}
-	err := readElements(r, &hdr.magic, &command, &hdr.length, &hdr.checksum)
+	err = readElements(hr, &hdr.magic, &command, &hdr.length, &hdr.checksum)
 	if err != nil {
-		return nil, err
+		return n, nil, err
 	}
 
 	// Strip trailing zeros from command string.
 	hdr.command = string(bytes.TrimRight(command[:], string(0)))
 
-	return &hdr, nil
+	return n, &hdr, nil
 }
 
 // discardInput reads n bytes from reader r in chunks and discards the read
 // bytes.  This is used to skip payloads when various errors occur and helps
 // prevent rogue nodes from causing massive memory allocation through forging
-// header length.
-func discardInput(r io.Reader, n uint32) {
+// header length.  It returns the number of bytes actually read, which may be
+// less than n if the reader is exhausted or errors out early.
+func discardInput(r io.Reader, n uint32) int {
+	totalBytes := 0
 	maxSize := uint32(10 * 1024) // 10k at a time
 	numReads := n / maxSize
 	bytesRemaining := n % maxSize
 	if n > 0 {
 		buf := make([]byte, maxSize)
 		for i := uint32(0); i < numReads; i++ {
-			io.ReadFull(r, buf)
+			n, err := io.ReadFull(r, buf)
+			totalBytes += n
+			if err != nil {
+				return totalBytes
+			}
 		}
 	}
 	if bytesRemaining > 0 {
 		buf := make([]byte, bytesRemaining)
-		io.ReadFull(r, buf)
+		n, _ := io.ReadFull(r, buf)
+		totalBytes += n
 	}
+	return totalBytes
 }
 
-// WriteMessage writes a bitcoin Message to w including the necessary header
-// information.
-func WriteMessage(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) error {
-	var command [commandSize]byte
+// WriteMessageN writes a bitcoin Message to w including the necessary header
+// information and returns the number of bytes written.
+func WriteMessageN(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) (int, error) {
+	totalBytes := 0
+
+	var command [CommandSize]byte
 
 	// Enforce max command size.
 	cmd := msg.Command()
-	if len(cmd) > commandSize {
+	if len(cmd) > CommandSize {
 		str := fmt.Sprintf("command [%s] is too long [max %v]",
-			cmd, commandSize)
-		return messageError("WriteMessage", str)
+			cmd, CommandSize)
+		return totalBytes, messageError("WriteMessage", str)
 	}
 	copy(command[:], []byte(cmd))
 
@@ -171,17 +232,17 @@ func WriteMessage(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) erro
 	var bw bytes.Buffer
 	err := msg.BtcEncode(&bw, pver)
 	if err != nil {
-		return err
+		return totalBytes, err
 	}
 	payload := bw.Bytes()
 	lenp := len(payload)
 
 	// Enforce maximum overall message payload.
-	if lenp > maxMessagePayload {
+	if lenp > MaxMessagePayload {
 		str := fmt.Sprintf("message payload is too large - encoded "+
 			"%d bytes, but maximum message payload is %d bytes",
-			lenp, maxMessagePayload)
-		return messageError("WriteMessage", str)
+			lenp, MaxMessagePayload)
+		return totalBytes, messageError("WriteMessage", str)
 	}
 
 	// Enforce maximum message payload based on the message type.
@@ -190,7 +251,7 @@ func WriteMessage(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) erro
 		str := fmt.Sprintf("message payload is too large - encoded "+
 			"%d bytes, but maximum message payload size for "+
 			"messages of type [%s] is %d.", lenp, cmd, mpl)
-		return messageError("WriteMessage", str)
+		return totalBytes, messageError("WriteMessage", str)
 	}
 
 	// Create header for the message.
@@ -201,56 +262,80 @@ func WriteMessage(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) erro
 	copy(hdr.checksum[:], DoubleSha256(payload)[0:4])
 
 	// Write header.
-	err = writeElements(w, hdr.magic, command, hdr.length, hdr.checksum)
+	var hw bytes.Buffer
+	err = writeElements(&hw, hdr.magic, command, hdr.length, hdr.checksum)
 	if err != nil {
-		return err
+		return totalBytes, err
+	}
+	n, err := w.Write(hw.Bytes())
+	totalBytes += n
+	if err != nil {
+		return totalBytes, err
 	}
 
 	// Write payload.
-	_, err = w.Write(payload)
+	n, err = w.Write(payload)
+	totalBytes += n
 	if err != nil {
-		return err
+		return totalBytes, err
 	}
-	return nil
+	return totalBytes, nil
 }
 
-// ReadMessage reads, validates, and parses the next bitcoin Message from r for
-// the provided protocol version and bitcoin network.
-func ReadMessage(r io.Reader, pver uint32, btcnet BitcoinNet) (Message, []byte, error) {
-	hdr, err := readMessageHeader(r)
+// WriteMessage writes a bitcoin Message to w including the necessary header
+// information.  This function is the same as WriteMessageN except it omits
+// the exact number of bytes written.  This function is only here as an
+// integration aid for callers that don't care about the number of bytes
+// written.
+func WriteMessage(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) error {
+	_, err := WriteMessageN(w, msg, pver, btcnet)
+	return err
+}
+
+// ReadMessageN reads, validates, and parses the next bitcoin Message from r
+// for the provided protocol version and bitcoin network.  It returns the
+// number of bytes read in addition to the parsed Message and raw bytes which
+// comprise the message.  This function is the core work horse for
+// ReadMessage.  It is exported so it can be used directly in cases where the
+// number of bytes read is important, such as to track bandwidth usage
+// between peers.
+func ReadMessageN(r io.Reader, pver uint32, btcnet BitcoinNet) (int, Message, []byte, error) {
+	totalBytes := 0
+	n, hdr, err := readMessageHeader(r)
+	totalBytes += n
 	if err != nil {
-		return nil, nil, err
+		return totalBytes, nil, nil, err
 	}
 
 	// Enforce maximum message payload.
-	if hdr.length > maxMessagePayload {
+	if hdr.length > MaxMessagePayload {
 		str := fmt.Sprintf("message payload is too large - header "+
 			"indicates %d bytes, but max message payload is %d "+
-			"bytes.", hdr.length, maxMessagePayload)
-		return nil, nil, messageError("ReadMessage", str)
+			"bytes.", hdr.length, MaxMessagePayload)
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
 
 	}
 
 	// Check for messages from the wrong bitcoin network.
 	if hdr.magic != btcnet {
-		discardInput(r, hdr.length)
+		totalBytes += discardInput(r, hdr.length)
 		str := fmt.Sprintf("message from other network [%v]", hdr.magic)
-		return nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
 	// Check for malformed commands.
 	command := hdr.command
 	if !utf8.ValidString(command) {
-		discardInput(r, hdr.length)
+		totalBytes += discardInput(r, hdr.length)
 		str := fmt.Sprintf("invalid command %v", []byte(command))
-		return nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
 	// Create struct of appropriate message type based on the command.
 	msg, err := makeEmptyMessage(command)
 	if err != nil {
-		discardInput(r, hdr.length)
-		return nil, nil, messageError("ReadMessage", err.Error())
+		totalBytes += discardInput(r, hdr.length)
+		return totalBytes, nil, nil, messageError("ReadMessage", err.Error())
 	}
 
 	// Check for maximum length based on the message type as a malicious client
@@ -258,18 +343,19 @@ func ReadMessage(r io.Reader, pver uint32, btcnet BitcoinNet) (Message, []byte,
 	// numbers in order to exhaust the machine's memory.
 	mpl := msg.MaxPayloadLength(pver)
 	if hdr.length > mpl {
-		discardInput(r, hdr.length)
+		totalBytes += discardInput(r, hdr.length)
 		str := fmt.Sprintf("payload exceeds max length - header "+
 			"indicates %v bytes, but max payload size for "+
 			"messages of type [%v] is %v.", hdr.length, command, mpl)
-		return nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
 	// Read payload.
 	payload := make([]byte, hdr.length)
-	_, err = io.ReadFull(r, payload)
+	n, err = io.ReadFull(r, payload)
+	totalBytes += n
 	if err != nil {
-		return nil, nil, err
+		return totalBytes, nil, nil, err
 	}
 
 	// Test checksum.
@@ -278,15 +364,26 @@ func ReadMessage(r io.Reader, pver uint32, btcnet BitcoinNet) (Message, []byte,
 		str := fmt.Sprintf("payload checksum failed - header "+
 			"indicates %v, but actual checksum is %v.",
 			hdr.checksum, checksum)
-		return nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
 	// Unmarshal message.
 	pr := bytes.NewBuffer(payload)
 	err = msg.BtcDecode(pr, pver)
 	if err != nil {
-		return nil, nil, err
+		return totalBytes, nil, nil, err
 	}
 
-	return msg, payload, nil
+	return totalBytes, msg, payload, nil
+}
+
+// ReadMessage reads, validates, and parses the next bitcoin Message from r
+// for the provided protocol version and bitcoin network.  It returns the
+// parsed Message and raw bytes which comprise the message.  This function
+// is the same as ReadMessageN except it omits the exact number of bytes
+// read.  This function is only here as an integration aid for callers that
+// don't care about the number of bytes read.
+func ReadMessage(r io.Reader, pver uint32, btcnet BitcoinNet) (Message, []byte, error) {
+	_, msg, buf, err := ReadMessageN(r, pver, btcnet)
+	return msg, buf, err
 }
@@ -0,0 +1,48 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"testing"
+)
+
+// TestMessageRegistry exercises RegisterMessage and UnregisterMessage,
+// including the duplicate-registration error and that makeEmptyMessage
+// reflects the registry's current contents.
+func TestMessageRegistry(t *testing.T) {
+	const testCmd = "testmsg"
+	factory := func() Message { return &MsgVerAck{} }
+
+	// A brand-new command should register cleanly and be resolvable.
+	if err := RegisterMessage(testCmd, factory); err != nil {
+		t.Fatalf("RegisterMessage: unexpected error %v", err)
+	}
+	if _, err := makeEmptyMessage(testCmd); err != nil {
+		t.Errorf("makeEmptyMessage: unexpected error after registering %q: %v",
+			testCmd, err)
+	}
+
+	// Registering the same command again must fail.
+	if err := RegisterMessage(testCmd, factory); err == nil {
+		t.Error("RegisterMessage: did not receive error for duplicate command")
+	}
+
+	// Unregistering removes the command, making it unhandled again.
+	UnregisterMessage(testCmd)
+	if _, err := makeEmptyMessage(testCmd); err == nil {
+		t.Errorf("makeEmptyMessage: did not receive error for unregistered command %q",
+			testCmd)
+	}
+
+	// Unregistering a command that is not currently registered is a no-op.
+	UnregisterMessage(testCmd)
+
+	// The command can be registered again after being unregistered.
+	if err := RegisterMessage(testCmd, factory); err != nil {
+		t.Fatalf("RegisterMessage: unexpected error re-registering %q: %v",
+			testCmd, err)
+	}
+	UnregisterMessage(testCmd)
+}
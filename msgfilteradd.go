@@ -0,0 +1,80 @@
+// Copyright (c) 2013-2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MaxFilterAddDataSize is the maximum size in bytes of data to be added to
+// a bloom filter via a filteradd message.
+const MaxFilterAddDataSize = 520
+
+// MsgFilterAdd implements the Message interface and represents a bitcoin
+// filteradd message which is used to add a data element to an existing
+// bloom filter such as a public key, a public key hash, or an outpoint.
+// This message is only valid for protocol versions >= BIP0037Version.
+type MsgFilterAdd struct {
+	// Data is the element to add to the current filter.
+	Data []byte
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgFilterAdd) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < BIP0037Version {
+		str := fmt.Sprintf("filteradd message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgFilterAdd.BtcDecode", str)
+	}
+
+	data, err := readVarBytes(r, pver, MaxFilterAddDataSize,
+		"filteradd data size")
+	if err != nil {
+		return err
+	}
+	msg.Data = data
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgFilterAdd) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < BIP0037Version {
+		str := fmt.Sprintf("filteradd message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgFilterAdd.BtcEncode", str)
+	}
+
+	if len(msg.Data) > MaxFilterAddDataSize {
+		str := fmt.Sprintf("filteradd data size too large for message "+
+			"[size %v, max %v]", len(msg.Data), MaxFilterAddDataSize)
+		return messageError("MsgFilterAdd.BtcEncode", str)
+	}
+
+	return writeVarBytes(w, pver, msg.Data)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgFilterAdd) Command() string {
+	return cmdFilterAdd
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgFilterAdd) MaxPayloadLength(pver uint32) uint32 {
+	return maxVarIntPayload + MaxFilterAddDataSize
+}
+
+// NewMsgFilterAdd returns a new bitcoin filteradd message that conforms to
+// the Message interface.  See MsgFilterAdd for details.
+func NewMsgFilterAdd(data []byte) *MsgFilterAdd {
+	return &MsgFilterAdd{
+		Data: data,
+	}
+}
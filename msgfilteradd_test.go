@@ -0,0 +1,51 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestFilterAddDataSize tests that encoding and decoding a filteradd message
+// rejects data larger than MaxFilterAddDataSize.
+func TestFilterAddDataSize(t *testing.T) {
+	pver := BIP0037Version
+
+	// Encoding data one byte over the max size must fail.
+	msg := NewMsgFilterAdd(make([]byte, MaxFilterAddDataSize+1))
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for oversized data")
+	}
+
+	// Decoding a wire payload that claims a data size over the max must
+	// fail without reading the (nonexistent) data bytes.
+	var wireBuf bytes.Buffer
+	if err := writeVarInt(&wireBuf, pver, uint64(MaxFilterAddDataSize+1)); err != nil {
+		t.Fatalf("writeVarInt: unexpected error %v", err)
+	}
+	var decoded MsgFilterAdd
+	if err := decoded.BtcDecode(&wireBuf, pver); err == nil {
+		t.Error("BtcDecode: did not receive error for oversized data")
+	}
+}
+
+// TestFilterAddProtocolVersion tests that filteradd rejects protocol
+// versions prior to BIP0037Version.
+func TestFilterAddProtocolVersion(t *testing.T) {
+	pver := BIP0037Version - 1
+
+	msg := NewMsgFilterAdd([]byte{0x01})
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for old protocol version")
+	}
+
+	var decoded MsgFilterAdd
+	if err := decoded.BtcDecode(bytes.NewReader([]byte{}), pver); err == nil {
+		t.Error("BtcDecode: did not receive error for old protocol version")
+	}
+}
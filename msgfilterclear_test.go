@@ -0,0 +1,27 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestFilterClearProtocolVersion tests that filterclear rejects protocol
+// versions prior to BIP0037Version.
+func TestFilterClearProtocolVersion(t *testing.T) {
+	pver := BIP0037Version - 1
+
+	msg := NewMsgFilterClear()
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for old protocol version")
+	}
+
+	var decoded MsgFilterClear
+	if err := decoded.BtcDecode(bytes.NewReader([]byte{}), pver); err == nil {
+		t.Error("BtcDecode: did not receive error for old protocol version")
+	}
+}
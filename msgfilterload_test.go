@@ -0,0 +1,79 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestFilterLoadFilterSize tests that encoding and decoding a filterload
+// message rejects a filter larger than MaxFilterLoadFilterSize.
+func TestFilterLoadFilterSize(t *testing.T) {
+	pver := BIP0037Version
+
+	// Encoding a filter one byte over the max size must fail.
+	msg := NewMsgFilterLoad(make([]byte, MaxFilterLoadFilterSize+1), 10, 0, 0)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for oversized filter")
+	}
+
+	// Decoding a wire payload that claims a filter size over the max must
+	// fail without reading the (nonexistent) filter bytes.
+	var wireBuf bytes.Buffer
+	if err := writeVarInt(&wireBuf, pver, uint64(MaxFilterLoadFilterSize+1)); err != nil {
+		t.Fatalf("writeVarInt: unexpected error %v", err)
+	}
+	var decoded MsgFilterLoad
+	if err := decoded.BtcDecode(&wireBuf, pver); err == nil {
+		t.Error("BtcDecode: did not receive error for oversized filter")
+	}
+}
+
+// TestFilterLoadHashFuncs tests that encoding and decoding a filterload
+// message rejects a hash function count larger than
+// MaxFilterLoadHashFuncs.
+func TestFilterLoadHashFuncs(t *testing.T) {
+	pver := BIP0037Version
+
+	msg := NewMsgFilterLoad([]byte{0x01}, MaxFilterLoadHashFuncs+1, 0, 0)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for too many hash funcs")
+	}
+
+	// A wire payload with a valid filter but an oversized hash func count
+	// must also be rejected on decode.
+	var wireBuf bytes.Buffer
+	if err := writeVarBytes(&wireBuf, pver, []byte{0x01}); err != nil {
+		t.Fatalf("writeVarBytes: unexpected error %v", err)
+	}
+	if err := writeElements(&wireBuf, uint32(MaxFilterLoadHashFuncs+1), uint32(0), uint8(0)); err != nil {
+		t.Fatalf("writeElements: unexpected error %v", err)
+	}
+
+	var decoded MsgFilterLoad
+	if err := decoded.BtcDecode(&wireBuf, pver); err == nil {
+		t.Error("BtcDecode: did not receive error for too many hash funcs")
+	}
+}
+
+// TestFilterLoadProtocolVersion tests that filterload rejects protocol
+// versions prior to BIP0037Version.
+func TestFilterLoadProtocolVersion(t *testing.T) {
+	pver := BIP0037Version - 1
+
+	msg := NewMsgFilterLoad([]byte{0x01}, 10, 0, 0)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for old protocol version")
+	}
+
+	var decoded MsgFilterLoad
+	if err := decoded.BtcDecode(bytes.NewReader([]byte{}), pver); err == nil {
+		t.Error("BtcDecode: did not receive error for old protocol version")
+	}
+}
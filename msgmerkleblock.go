@@ -0,0 +1,183 @@
+// Copyright (c) 2013-2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxFlagsPerMerkleBlock is the maximum number of flag bytes a merkleblock
+// message may carry, set to one quarter of the max message payload.
+const maxFlagsPerMerkleBlock = MaxMessagePayload / 4
+
+// minTxPayload is the minimum payload size of a transaction.  Note that a
+// transaction with no inputs or outputs is not a valid transaction on the
+// network, but that doesn't stop it from being a valid lower bound when
+// reasoning about the maximum number of transactions a block could carry.
+const minTxPayload = 10
+
+// maxTxPerBlock is the maximum number of transactions that could possibly
+// fit into a block, given the minimum possible size of a transaction, and is
+// therefore also the maximum number of hashes a merkleblock message may
+// carry.
+const maxTxPerBlock = MaxMessagePayload / minTxPayload
+
+// MsgMerkleBlock implements the Message interface and represents a bitcoin
+// merkleblock message which is used to reply to a getdata request for a
+// block matched by a previously loaded bloom filter (filterload).  It
+// contains the block header along with a partial merkle branch proving
+// which transactions in the block matched the filter, rather than the full
+// list of transactions sent in a block message.  This message is only valid
+// for protocol versions >= BIP0037Version.
+type MsgMerkleBlock struct {
+	// Header is the block header for the block being described.
+	Header BlockHeader
+
+	// Transactions is the number of transactions in the block.
+	Transactions uint32
+
+	// Hashes are the leaf hashes of the partial merkle tree in depth-first
+	// order as defined by BIP0037.
+	Hashes []*ShaHash
+
+	// Flags is a bit vector that, along with Hashes, describes how to
+	// reconstruct the partial merkle tree.
+	Flags []byte
+}
+
+// AddTxHash adds a new transaction hash to the message.
+func (msg *MsgMerkleBlock) AddTxHash(hash *ShaHash) error {
+	if len(msg.Hashes)+1 > maxTxPerBlock {
+		str := fmt.Sprintf("too many tx hashes for message [max %v]",
+			maxTxPerBlock)
+		return messageError("MsgMerkleBlock.AddTxHash", str)
+	}
+
+	msg.Hashes = append(msg.Hashes, hash)
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgMerkleBlock) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < BIP0037Version {
+		str := fmt.Sprintf("merkleblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgMerkleBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+
+	err = readElement(r, &msg.Transactions)
+	if err != nil {
+		return err
+	}
+
+	// Read num hashes and limit to max per message.
+	count, err := readVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction hashes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgMerkleBlock.BtcDecode", str)
+	}
+
+	hashes := make([]ShaHash, count)
+	msg.Hashes = make([]*ShaHash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		hash := &hashes[i]
+		err := readElement(r, hash)
+		if err != nil {
+			return err
+		}
+		msg.Hashes = append(msg.Hashes, hash)
+	}
+
+	flags, err := readVarBytes(r, pver, maxFlagsPerMerkleBlock,
+		"merkleblock flags size")
+	if err != nil {
+		return err
+	}
+	msg.Flags = flags
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgMerkleBlock) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < BIP0037Version {
+		str := fmt.Sprintf("merkleblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgMerkleBlock.BtcEncode", str)
+	}
+
+	// Limit num transaction hashes to max per message.
+	numHashes := len(msg.Hashes)
+	if numHashes > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction hashes for message "+
+			"[count %v, max %v]", numHashes, maxTxPerBlock)
+		return messageError("MsgMerkleBlock.BtcEncode", str)
+	}
+
+	numFlagBytes := len(msg.Flags)
+	if numFlagBytes > maxFlagsPerMerkleBlock {
+		str := fmt.Sprintf("too many flag bytes for message [count %v, "+
+			"max %v]", numFlagBytes, maxFlagsPerMerkleBlock)
+		return messageError("MsgMerkleBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+
+	err = writeElement(w, msg.Transactions)
+	if err != nil {
+		return err
+	}
+
+	err = writeVarInt(w, pver, uint64(numHashes))
+	if err != nil {
+		return err
+	}
+	for _, hash := range msg.Hashes {
+		err = writeElement(w, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeVarBytes(w, pver, msg.Flags)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgMerkleBlock) Command() string {
+	return cmdMerkleBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgMerkleBlock) MaxPayloadLength(pver uint32) uint32 {
+	return MaxMessagePayload
+}
+
+// NewMsgMerkleBlock returns a new bitcoin merkleblock message that conforms
+// to the Message interface.  See MsgMerkleBlock for details.
+func NewMsgMerkleBlock(bh *BlockHeader) *MsgMerkleBlock {
+	return &MsgMerkleBlock{
+		Header:       *bh,
+		Transactions: 0,
+		Hashes:       make([]*ShaHash, 0, 10),
+		Flags:        make([]byte, 0, 10),
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestMerkleBlockProtocolVersion tests that merkleblock rejects protocol
+// versions prior to BIP0037Version.
+func TestMerkleBlockProtocolVersion(t *testing.T) {
+	pver := BIP0037Version - 1
+
+	msg := NewMsgMerkleBlock(&BlockHeader{})
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for old protocol version")
+	}
+
+	var decoded MsgMerkleBlock
+	if err := decoded.BtcDecode(bytes.NewReader([]byte{}), pver); err == nil {
+		t.Error("BtcDecode: did not receive error for old protocol version")
+	}
+}
+
+// TestMerkleBlockAddTxHashTooMany tests that AddTxHash rejects adding more
+// transaction hashes than maxTxPerBlock allows.
+func TestMerkleBlockAddTxHashTooMany(t *testing.T) {
+	msg := NewMsgMerkleBlock(&BlockHeader{})
+	msg.Hashes = make([]*ShaHash, maxTxPerBlock)
+
+	if err := msg.AddTxHash(&ShaHash{}); err == nil {
+		t.Error("AddTxHash: did not receive error for exceeding maxTxPerBlock")
+	}
+}
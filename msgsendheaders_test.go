@@ -0,0 +1,27 @@
+// Copyright (c) 2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSendHeadersProtocolVersion tests that sendheaders rejects protocol
+// versions prior to BIP0130Version.
+func TestSendHeadersProtocolVersion(t *testing.T) {
+	pver := BIP0130Version - 1
+
+	msg := NewMsgSendHeaders()
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Error("BtcEncode: did not receive error for old protocol version")
+	}
+
+	var decoded MsgSendHeaders
+	if err := decoded.BtcDecode(bytes.NewReader([]byte{}), pver); err == nil {
+		t.Error("BtcDecode: did not receive error for old protocol version")
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2013-2014 Conformal Systems LLC.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcwire
+
+// ProtocolVersion is the latest protocol version this package supports.
+const ProtocolVersion uint32 = 70013
+
+// BIP0037Version is the protocol version which added the bloom filter
+// related commands (filterload, filteradd, filterclear, merkleblock) as
+// defined by BIP0037.
+const BIP0037Version uint32 = 70001
+
+// BIP0130Version is the protocol version which added the sendheaders
+// message as defined by BIP0130.
+const BIP0130Version uint32 = 70012
+
+// BIP0133Version is the protocol version which added the feefilter message
+// as defined by BIP0133.
+const BIP0133Version uint32 = 70013
+
+// ServiceFlag identifies services supported by a bitcoin peer.
+type ServiceFlag uint64
+
+const (
+	// SFNodeNetwork is a flag used to indicate a peer is a full node.
+	SFNodeNetwork ServiceFlag = 1 << iota
+
+	// SFNodeBloom is a flag used to indicate a peer supports bloom
+	// filtering as described by BIP0037.
+	SFNodeBloom
+)